@@ -15,21 +15,21 @@
 package main
 
 import (
-	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"strings"
 	"time"
 
 	"github.com/go-openapi/loads"
 	"go.uber.org/zap"
-	"go.uber.org/zap/zapcore"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/utils/net"
 
+	"github.com/bloomberg/goldpinger/v3/pkg/collect"
 	"github.com/bloomberg/goldpinger/v3/pkg/goldpinger"
 	"github.com/bloomberg/goldpinger/v3/pkg/restapi"
 	"github.com/bloomberg/goldpinger/v3/pkg/restapi/operations"
@@ -41,38 +41,17 @@ var (
 	Version, Build string
 )
 
-func getLogger(logLevel string) (*zap.Logger, error) {
-	var cfg zap.Config
-
-	// Set base config based on log level
-	switch strings.ToLower(logLevel) {
-	case "debug":
-		cfg = zap.NewDevelopmentConfig()
-		cfg.Level = zap.NewAtomicLevelAt(zap.DebugLevel)
-	case "info":
-		cfg = zap.NewProductionConfig()
-		cfg.Level = zap.NewAtomicLevelAt(zap.InfoLevel)
-	case "warn":
-		cfg = zap.NewProductionConfig()
-		cfg.Level = zap.NewAtomicLevelAt(zap.WarnLevel)
-	case "error":
-		cfg = zap.NewProductionConfig()
-		cfg.Level = zap.NewAtomicLevelAt(zap.ErrorLevel)
-	default:
-		cfg = zap.NewProductionConfig()
-		cfg.Level = zap.NewAtomicLevelAt(zap.InfoLevel)
-	}
-
-	// Use console encoding for better readability
-	cfg.Encoding = "console"
-	cfg.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
-
-	logger, err := cfg.Build()
-	if err != nil {
-		return nil, fmt.Errorf("Could not build logger: %w", err)
-	}
-
-	return logger, nil
+// withDebugLogLevel intercepts path and serves it from debug instead of
+// passing the request through to next, so /debug/log-level can be added to
+// the generated swagger handler without regenerating it.
+func withDebugLogLevel(next http.Handler, debug http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/debug/log-level" {
+			debug.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
 }
 
 func main() {
@@ -91,6 +70,15 @@ func main() {
 	parser.ShortDescription = "Goldpinger"
 	parser.LongDescription = swaggerSpec.Spec().Info.Description
 
+	if _, err := parser.AddCommand(
+		"collect",
+		"Collect a support bundle",
+		"Run a one-shot full mesh check and write a tarball of the check-all result, resolved topology and peer pod logs, for attaching to a bug report.",
+		&collect.Options{},
+	); err != nil {
+		log.Fatalf("Could not add collect command: %v", err)
+	}
+
 	// parse flags
 	server.ConfigureFlags()
 	for _, optsGroup := range api.CommandLineOptionsGroups {
@@ -110,12 +98,24 @@ func main() {
 		os.Exit(code)
 	}
 
+	// A subcommand (currently just "collect") has already run via its own
+	// Execute method by the time Parse returns; there's no server to start.
+	if parser.Active != nil {
+		return
+	}
+
 	// Configure logger
-	logger, err := getLogger(goldpinger.GoldpingerConfig.LogLevel)
+	logger, logLevel, err := goldpinger.BuildLogger(
+		goldpinger.GoldpingerConfig.LogLevel,
+		goldpinger.GoldpingerConfig.LogFormat,
+		goldpinger.GoldpingerConfig.LogSamplingInitial,
+		goldpinger.GoldpingerConfig.LogSamplingThereafter,
+	)
 	if err != nil {
 		log.Fatalf("Could not build logger: %v", err)
 	}
 	defer logger.Sync()
+	goldpinger.GoldpingerConfig.LogAtomicLevel = logLevel
 
 	// Set as global logger
 	zap.ReplaceGlobals(logger)
@@ -193,7 +193,49 @@ func main() {
 		goldpinger.GoldpingerConfig.CheckAllTimeout = time.Duration(goldpinger.GoldpingerConfig.CheckAllTimeoutMs) * time.Millisecond
 	}
 
+	// Load pluggable probe backends before the updater starts using them:
+	// a directory of Go plugins, and/or a gRPC sidecar over a Unix socket.
+	if err := goldpinger.LoadProberPlugins(goldpinger.GoldpingerConfig.ProbePluginDir); err != nil {
+		logger.Fatal("Could not load probe plugins", zap.Error(err))
+	}
+	if goldpinger.GoldpingerConfig.ProbeGRPCSocket != "" {
+		grpcProber, err := goldpinger.NewGRPCProber(goldpinger.GoldpingerConfig.ProbeGRPCSocket)
+		if err != nil {
+			logger.Fatal("Could not dial probe gRPC sidecar", zap.Error(err))
+		}
+		goldpinger.RegisterProber(goldpinger.GoldpingerConfig.ProbeGRPCName, grpcProber)
+	}
+
 	server.ConfigureAPI()
+
+	// /debug/log-level is authenticated by default: if --debug-disable-auth
+	// wasn't passed and no password was configured, generate a random one
+	// rather than serving the endpoint open.
+	var debugHandler http.Handler = logLevel
+	if !goldpinger.GoldpingerConfig.DebugDisableAuth {
+		if goldpinger.GoldpingerConfig.DebugPassword == "" {
+			password, err := goldpinger.GenerateDebugPassword()
+			if err != nil {
+				logger.Fatal("Could not generate a /debug/log-level password", zap.Error(err))
+			}
+			goldpinger.GoldpingerConfig.DebugPassword = password
+			logger.Info("Generated a random /debug/log-level password since --debug-password wasn't set",
+				zap.String("debug-username", goldpinger.GoldpingerConfig.DebugUsername),
+				zap.String("debug-password", password),
+			)
+		}
+		debugHandler = goldpinger.LogLevelHandler(
+			logLevel,
+			goldpinger.GoldpingerConfig.DebugUsername,
+			goldpinger.GoldpingerConfig.DebugPassword,
+		)
+	}
+
+	// Mount the atomic log level endpoint on the same server the rest of
+	// the API is served on, so it shares its listener, TLS and shutdown
+	// handling rather than standing up a second one.
+	server.SetHandler(withDebugLogLevel(server.GetHandler(), debugHandler))
+
 	goldpinger.StartUpdater()
 
 	logger.Info("All good, starting serving the API")
@@ -0,0 +1,298 @@
+// Copyright 2018 Bloomberg Finance L.P.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package collect implements the `goldpinger collect` subcommand: a one-shot
+// support-bundle collector that saves a full mesh check, resolved topology
+// and peer pod logs into a single tarball, so a user can attach one artifact
+// to a bug report instead of scraping /check_all by hand.
+package collect
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Options configures the `goldpinger collect` command. It is registered as a
+// go-flags subcommand alongside the server's own flags in
+// cmd/goldpinger/main.go.
+type Options struct {
+	CollectDelay   time.Duration `long:"collect-delay" default:"0s" description:"how long to wait before running the one-shot collection, to let a just-rolled-out mesh settle"`
+	ServiceAccount string        `long:"service-account" description:"path to a service account token file used to authenticate to the cluster, instead of the pod's own"`
+	KubeConfigPath string        `long:"kubeconfig" description:"path to a kubeconfig; if unset, in-cluster config is used"`
+	Namespace      string        `long:"namespace" description:"namespace the goldpinger mesh runs in" default:"default"`
+	APIAddr        string        `long:"api-addr" default:"http://localhost:8080" description:"address of a goldpinger peer to run the check-all against"`
+	OutputDir      string        `long:"output-dir" default:"." description:"directory the collected bundle is written under"`
+}
+
+// manifest is written as index.json at the root of the bundle, listing every
+// collected artifact and the schema it was collected against.
+type manifest struct {
+	Generated time.Time         `json:"generated"`
+	Artifacts map[string]string `json:"artifacts"`
+}
+
+// bundle accumulates the files that make up a support bundle under a
+// timestamped root directory, then archives them into a single tarball.
+type bundle struct {
+	root     string
+	manifest manifest
+}
+
+// Execute runs a one-shot full mesh check and writes a support bundle
+// containing the raw check-all result, resolved topology and peer pod logs.
+func (o *Options) Execute(args []string) error {
+	if o.CollectDelay > 0 {
+		zap.L().Info("Waiting before collecting", zap.Duration("delay", o.CollectDelay))
+		time.Sleep(o.CollectDelay)
+	}
+
+	root := filepath.Join(o.OutputDir, fmt.Sprintf("goldpinger-bundle-%s", time.Now().UTC().Format("20060102T150405Z")))
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return fmt.Errorf("could not create bundle dir %q: %w", root, err)
+	}
+
+	b := &bundle{root: root, manifest: manifest{Generated: time.Now().UTC(), Artifacts: map[string]string{}}}
+
+	checkAll, err := fetchCheckAll(o.APIAddr)
+	if err != nil {
+		zap.L().Warn("Could not fetch check-all result", zap.Error(err))
+	} else if err := b.writeJSON("check_all.json", "goldpinger.v3.CheckAllResponse", checkAll); err != nil {
+		return err
+	}
+
+	clientset, err := buildClientset(o)
+	if err != nil {
+		zap.L().Warn("Could not build kubernetes client, skipping peer pod log collection", zap.Error(err))
+	} else if err := b.collectPeerLogs(clientset, o.Namespace); err != nil {
+		zap.L().Warn("Could not collect peer pod logs", zap.Error(err))
+	}
+
+	if err := b.writeManifest(); err != nil {
+		return err
+	}
+
+	tarPath := root + ".tar.gz"
+	if err := b.archive(tarPath); err != nil {
+		return fmt.Errorf("could not write bundle archive: %w", err)
+	}
+
+	zap.L().Info("Wrote support bundle", zap.String("path", tarPath))
+	return nil
+}
+
+// fetchCheckAll runs a one-shot full mesh check by hitting a peer's
+// /check_all endpoint, the same one operators would otherwise scrape by
+// hand.
+func fetchCheckAll(apiAddr string) (map[string]interface{}, error) {
+	resp, err := http.Get(apiAddr + "/check_all")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s/check_all returned non-200 resp: %d", apiAddr, resp.StatusCode)
+	}
+
+	var out map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("could not decode check-all response: %w", err)
+	}
+	return out, nil
+}
+
+// buildClientset mirrors the in-cluster/kubeconfig fallback used by the
+// server command, with an optional --service-account override for
+// environments where the collector runs under different credentials than
+// the mesh it's inspecting.
+func buildClientset(o *Options) (kubernetes.Interface, error) {
+	var config *rest.Config
+	var err error
+
+	if o.KubeConfigPath != "" {
+		config, err = clientcmd.BuildConfigFromFlags("", o.KubeConfigPath)
+	} else {
+		config, err = rest.InClusterConfig()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if o.ServiceAccount != "" {
+		token, err := os.ReadFile(o.ServiceAccount)
+		if err != nil {
+			return nil, fmt.Errorf("could not read service account token %q: %w", o.ServiceAccount, err)
+		}
+		config.BearerToken = string(token)
+		config.BearerTokenFile = o.ServiceAccount
+	}
+
+	return kubernetes.NewForConfig(config)
+}
+
+// collectPeerLogs resolves every goldpinger peer pod in namespace plus the
+// nodes they're scheduled on, and saves their logs and the pod/node specs
+// that produced them, so the topology a failure happened against is
+// preserved alongside the logs themselves.
+func (b *bundle) collectPeerLogs(clientset kubernetes.Interface, namespace string) error {
+	pods, err := clientset.CoreV1().Pods(namespace).List(context.Background(), metav1.ListOptions{
+		LabelSelector: "app=goldpinger",
+	})
+	if err != nil {
+		return fmt.Errorf("could not list goldpinger pods: %w", err)
+	}
+
+	if err := b.writeJSON("topology/pods.json", "corev1.PodList", pods); err != nil {
+		return err
+	}
+
+	if err := b.collectNodeTopology(clientset, pods.Items); err != nil {
+		zap.L().Warn("Could not collect node topology", zap.Error(err))
+	}
+
+	for _, pod := range pods.Items {
+		logs, err := fetchPodLogs(clientset, pod)
+		if err != nil {
+			zap.L().Warn("Could not fetch pod logs", zap.String("pod", pod.Name), zap.Error(err))
+			continue
+		}
+		if err := b.writeFile(filepath.Join("logs", pod.Name+".log"), "text/plain", logs); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// collectNodeTopology resolves the distinct nodes pods are scheduled on and
+// saves them, so a bug report carries the node topology a check ran against
+// alongside the pods themselves, not just the pod list in isolation.
+func (b *bundle) collectNodeTopology(clientset kubernetes.Interface, pods []corev1.Pod) error {
+	seen := map[string]bool{}
+	var nodes []corev1.Node
+	for _, pod := range pods {
+		if pod.Spec.NodeName == "" || seen[pod.Spec.NodeName] {
+			continue
+		}
+		seen[pod.Spec.NodeName] = true
+
+		node, err := clientset.CoreV1().Nodes().Get(context.Background(), pod.Spec.NodeName, metav1.GetOptions{})
+		if err != nil {
+			zap.L().Warn("Could not fetch node", zap.String("node", pod.Spec.NodeName), zap.Error(err))
+			continue
+		}
+		nodes = append(nodes, *node)
+	}
+
+	return b.writeJSON("topology/nodes.json", "corev1.NodeList", corev1.NodeList{Items: nodes})
+}
+
+func fetchPodLogs(clientset kubernetes.Interface, pod corev1.Pod) ([]byte, error) {
+	req := clientset.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{})
+	stream, err := req.Stream(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	return io.ReadAll(stream)
+}
+
+// writeJSON marshals v to root/relPath and records it, and its schema name,
+// in the bundle manifest.
+func (b *bundle) writeJSON(relPath, schema string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not marshal %s: %w", relPath, err)
+	}
+	return b.writeFile(relPath, schema, data)
+}
+
+// writeFile saves data to root/relPath, creating any intermediate
+// directories, and records it in the bundle manifest under schema.
+func (b *bundle) writeFile(relPath, schema string, data []byte) error {
+	path := filepath.Join(b.root, relPath)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return err
+	}
+	b.manifest.Artifacts[relPath] = schema
+	return nil
+}
+
+func (b *bundle) writeManifest() error {
+	data, err := json.MarshalIndent(b.manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not marshal manifest: %w", err)
+	}
+	return os.WriteFile(filepath.Join(b.root, "index.json"), data, 0o644)
+}
+
+// archive tars and gzips the bundle directory to tarPath.
+func (b *bundle) archive(tarPath string) error {
+	f, err := os.Create(tarPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gw := gzip.NewWriter(f)
+	defer gw.Close()
+	tw := tar.NewWriter(gw)
+	defer tw.Close()
+
+	return filepath.Walk(b.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(filepath.Dir(b.root), path)
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = relPath
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+}
@@ -0,0 +1,127 @@
+// Copyright 2018 Bloomberg Finance L.P.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goldpinger
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ProtocolResult is the outcome of a single protocol probe against a
+// neighbor.
+type ProtocolResult struct {
+	OK       bool          `json:"ok"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// CheckResults is the result of probing a single neighbor, broken down by
+// protocol, so operators can tell L3 reachability (icmp/udp) apart from
+// L4/L7 failures (tcp/http) within the same check.
+type CheckResults struct {
+	Protocols map[string]ProtocolResult `json:"protocols"`
+}
+
+// CheckNeighbor runs every protocol in GoldpingerConfig.ProbeProtocols (or
+// SupportedProbeProtocols, if none are configured) against host, plus any
+// custom probes named in specs, and returns a per-protocol breakdown. Each
+// ProbeProtocols entry may itself be a comma-separated list. This is what
+// StartUpdater calls on every tick for every neighbor; specs is built from
+// the --custom-probe names and is the same for every neighbor, with no
+// per-neighbor timeout or params.
+func CheckNeighbor(host string, port int, timeout time.Duration, specs ...ProbeSpec) CheckResults {
+	var protocols []string
+	for _, entry := range GoldpingerConfig.ProbeProtocols {
+		for _, protocol := range strings.Split(entry, ",") {
+			if protocol = strings.TrimSpace(protocol); protocol != "" {
+				protocols = append(protocols, protocol)
+			}
+		}
+	}
+	if len(protocols) == 0 {
+		protocols = SupportedProbeProtocols
+	}
+
+	results := CheckResults{Protocols: make(map[string]ProtocolResult, len(protocols)+len(specs))}
+	for _, protocol := range protocols {
+		results.Protocols[protocol] = runProtocolProbe(protocol, host, port, timeout)
+	}
+	for _, spec := range specs {
+		results.Protocols[spec.Name] = runCustomProbe(host, spec)
+	}
+	return results
+}
+
+// runCustomProbe runs a single custom ProbeSpec against host and turns its
+// result into a ProtocolResult, the same shape the built-in protocols report
+// through, so custom probes flow through /check_all aggregation unchanged.
+func runCustomProbe(host string, spec ProbeSpec) ProtocolResult {
+	start := time.Now()
+	probeResult, err := doCustomProbe(context.Background(), host, spec)
+	duration := time.Since(start)
+	if probeResult.Duration > 0 {
+		duration = probeResult.Duration
+	}
+
+	result := ProtocolResult{OK: err == nil && probeResult.Success, Duration: duration}
+	switch {
+	case err != nil:
+		result.Error = err.Error()
+	case !probeResult.Success:
+		result.Error = probeResult.Message
+	}
+	return result
+}
+
+// runProtocolProbe dispatches to the doXProbe for protocol, times it, and
+// turns its error into a ProtocolResult. host/port are combined into
+// whatever address shape the target protocol expects.
+func runProtocolProbe(protocol, host string, port int, timeout time.Duration) ProtocolResult {
+	start := time.Now()
+
+	var err error
+	switch protocol {
+	case "dns":
+		err = doDNSProbe(host, timeout)
+	case "tcp":
+		err = doTCPProbe(net.JoinHostPort(host, strconv.Itoa(port)), timeout)
+	case "http":
+		err = doHTTPProbe(fmt.Sprintf("http://%s/healthz", net.JoinHostPort(host, strconv.Itoa(port))), timeout)
+	case "icmp":
+		err = doICMPProbe(host, timeout)
+	case "udp":
+		err = doUDPProbe(net.JoinHostPort(host, strconv.Itoa(port)), timeout)
+	default:
+		err = fmt.Errorf("unknown probe protocol %q", protocol)
+	}
+
+	result := ProtocolResult{OK: err == nil, Duration: time.Since(start)}
+	probeDuration.WithLabelValues(protocol, strconv.FormatBool(err == nil)).Observe(result.Duration.Seconds())
+	if err != nil {
+		result.Error = err.Error()
+		zap.L().Debug("Protocol probe failed",
+			zap.String("protocol", protocol),
+			zap.String("host", host),
+			zap.Error(err),
+		)
+	}
+	return result
+}
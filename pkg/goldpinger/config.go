@@ -0,0 +1,96 @@
+// Copyright 2018 Bloomberg Finance L.P.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goldpinger
+
+import (
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+	"k8s.io/client-go/kubernetes"
+)
+
+// PodNamespace is the namespace this goldpinger instance is running in, as
+// reported by the downward API. It's the fallback used when --namespace
+// isn't set explicitly.
+var PodNamespace = os.Getenv("POD_NAMESPACE")
+
+// Config holds every flag-configurable setting goldpinger runs with. A
+// single instance, GoldpingerConfig, is populated by go-flags from the
+// command line and then read from everywhere else in the package.
+type Config struct {
+	LogLevel  string  `long:"log-level" default:"info" description:"log level: debug, info, warn or error"`
+	Namespace *string `long:"namespace" description:"namespace to ping pods in; defaults to this pod's own namespace"`
+
+	KubeConfigPath   string               `long:"kubeconfig" description:"path to a kubeconfig; if unset, in-cluster config is used"`
+	KubernetesClient kubernetes.Interface `no-flag:"true"`
+
+	Port  int    `long:"port" description:"port to serve the API on; defaults to the swagger-configured port"`
+	PodIP string `long:"pod-ip" env:"POD_IP" description:"this pod's own IP, used to avoid pinging itself"`
+
+	PingNumber int      `long:"ping-number" description:"number of peers to ping; 0 means ping all of them"`
+	IPVersions []string `long:"ip-version" default:"4" description:"IP version(s) to ping over"`
+
+	PingTimeout       time.Duration `long:"ping-timeout" description:"timeout for a single ping"`
+	PingTimeoutMs     int64         `long:"ping-timeout-ms" description:"deprecated, use --ping-timeout"`
+	CheckTimeout      time.Duration `long:"check-timeout" description:"timeout for a single check"`
+	CheckTimeoutMs    int64         `long:"check-timeout-ms" description:"deprecated, use --check-timeout"`
+	CheckAllTimeout   time.Duration `long:"check-all-timeout" description:"timeout for a full check-all run"`
+	CheckAllTimeoutMs int64         `long:"check-all-timeout-ms" description:"deprecated, use --check-all-timeout"`
+
+	// CheckInterval is how often StartUpdater re-checks every neighbor.
+	CheckInterval time.Duration `long:"check-interval" default:"5s" description:"how often to check every neighbor"`
+
+	// TLS options for outbound HTTPS probes. Verification is on by default;
+	// TLSInsecureSkipVerify is an explicit, documented opt-out.
+	TLSInsecureSkipVerify bool   `long:"tls-insecure-skip-verify" description:"skip TLS certificate verification on HTTPS probes"`
+	TLSCAFile             string `long:"tls-ca-file" description:"path to a PEM CA bundle trusted for HTTPS probes"`
+	TLSClientCertFile     string `long:"tls-client-cert-file" description:"path to a PEM client certificate for HTTPS probes"`
+	TLSClientKeyFile      string `long:"tls-client-key-file" description:"path to the PEM key for --tls-client-cert-file"`
+	TLSServerName         string `long:"tls-server-name" description:"override the server name used for TLS verification on HTTPS probes"`
+
+	// ProbeProtocols is the set of per-neighbor probes CheckNeighbor runs on
+	// every tick; see SupportedProbeProtocols for the accepted values.
+	ProbeProtocols []string `long:"probe-protocols" default:"dns,tcp,http" description:"comma-separated list of probe protocols to run against each neighbor: dns, tcp, http, icmp, udp"`
+
+	// Pluggable custom probes: either a directory of Go plugins, or a
+	// gRPC sidecar reachable over a Unix socket. See pkg/goldpinger/prober.go.
+	ProbePluginDir  string `long:"probe-plugin-dir" description:"directory of *.so Prober plugins to load at startup"`
+	ProbeGRPCSocket string `long:"probe-grpc-socket" description:"Unix socket of a gRPC Prober sidecar, as described by api/proto/prober.proto"`
+	ProbeGRPCName   string `long:"probe-grpc-name" default:"grpc" description:"name --probe-grpc-socket's Prober is registered under, for use in a ProbeSpec.Name"`
+
+	// CustomProbes names registered Probers (plugin- or gRPC-backed) that
+	// StartUpdater runs against every neighbor alongside ProbeProtocols.
+	CustomProbes []string `long:"custom-probe" description:"name of a registered custom Prober to run against every neighbor; repeatable"`
+
+	// Logging.
+	LogFormat             string `long:"log-format" default:"console" description:"log encoding: console or json"`
+	LogSamplingInitial    int    `long:"log-sampling-initial" description:"zap sampling: log this many entries per level and message per second before sampling kicks in"`
+	LogSamplingThereafter int    `long:"log-sampling-thereafter" description:"zap sampling: after the initial burst, log only every Nth entry per level and message per second"`
+	LogAtomicLevel        zap.AtomicLevel `no-flag:"true"`
+
+	// DebugUsername/DebugPassword gate /debug/log-level with HTTP basic
+	// auth. /debug/log-level is authenticated by default: DebugUsername
+	// defaults to "goldpinger", and if DebugPassword is left unset main()
+	// generates a random one rather than serving it unauthenticated.
+	// DebugDisableAuth is the explicit, documented opt-out.
+	DebugUsername    string `long:"debug-username" env:"GOLDPINGER_DEBUG_USERNAME" default:"goldpinger" description:"username required to access /debug/log-level"`
+	DebugPassword    string `long:"debug-password" env:"GOLDPINGER_DEBUG_PASSWORD" description:"password required to access /debug/log-level; a random one is generated and logged at startup if unset"`
+	DebugDisableAuth bool   `long:"debug-disable-auth" description:"serve /debug/log-level without authentication (insecure)"`
+}
+
+// GoldpingerConfig is the single, package-wide Config instance, populated by
+// go-flags from the command line in cmd/goldpinger/main.go.
+var GoldpingerConfig Config
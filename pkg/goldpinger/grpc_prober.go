@@ -0,0 +1,123 @@
+// Copyright 2018 Bloomberg Finance L.P.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goldpinger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding"
+)
+
+// grpcProbeMethod is the fully-qualified method name from
+// api/proto/prober.proto's Prober service.
+const grpcProbeMethod = "/goldpinger.prober.v1.Prober/Probe"
+
+// grpcProbeRequest/grpcProbeResponse mirror ProbeRequest/ProbeResponse from
+// api/proto/prober.proto field-for-field. They're plain Go structs rather
+// than protoc-generated types: jsonCodec below frames them over gRPC as
+// JSON, so a sidecar only needs to speak gRPC-framed JSON matching the
+// .proto's shape, with no protobuf code generation step on either side.
+type grpcProbeRequest struct {
+	Target    string            `json:"target"`
+	Params    map[string]string `json:"params"`
+	TimeoutMs int64             `json:"timeout_ms"`
+}
+
+type grpcProbeResponse struct {
+	Success    bool   `json:"success"`
+	DurationMs int64  `json:"duration_ms"`
+	Message    string `json:"message"`
+}
+
+// jsonCodec implements encoding.Codec by marshaling messages as JSON. It's
+// registered under a dedicated name and selected per-call via
+// grpc.CallContentSubtype, so it doesn't affect any other gRPC client in the
+// process.
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+func (jsonCodec) Name() string { return "json" }
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+// grpcProber proxies Prober.Probe to a sidecar listening on a local Unix
+// socket, described by api/proto/prober.proto. This is the alternative to a
+// Go plugin for teams that would rather ship their custom probe as its own
+// process than a .so built against goldpinger's exact Go toolchain version.
+type grpcProber struct {
+	conn *grpc.ClientConn
+}
+
+// NewGRPCProber sets up a client for the gRPC sidecar listening on socketPath
+// and returns a Prober backed by it. The socket is not dialed until the first
+// Probe, so a missing sidecar is not reported here. The returned Prober
+// should be registered with
+// RegisterProber under the name a ProbeSpec will reference.
+func NewGRPCProber(socketPath string) (Prober, error) {
+	conn, err := grpc.NewClient(
+		"passthrough:///"+socketPath,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socketPath)
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not dial probe sidecar at %q: %w", socketPath, err)
+	}
+
+	return &grpcProber{conn: conn}, nil
+}
+
+func (p *grpcProber) Probe(ctx context.Context, target string, opts ProbeOptions) (ProbeResult, error) {
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = defaultProbeTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req := &grpcProbeRequest{
+		Target:    target,
+		Params:    opts.Params,
+		TimeoutMs: timeout.Milliseconds(),
+	}
+	resp := &grpcProbeResponse{}
+	if err := p.conn.Invoke(ctx, grpcProbeMethod, req, resp, grpc.CallContentSubtype(jsonCodec{}.Name())); err != nil {
+		return ProbeResult{}, err
+	}
+
+	return ProbeResult{
+		Success:  resp.Success,
+		Duration: time.Duration(resp.DurationMs) * time.Millisecond,
+		Message:  resp.Message,
+	}, nil
+}
+
+// Close tears down the connection to the probe sidecar.
+func (p *grpcProber) Close() error {
+	return p.conn.Close()
+}
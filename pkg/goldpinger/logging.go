@@ -0,0 +1,105 @@
+// Copyright 2018 Bloomberg Finance L.P.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goldpinger
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// BuildLogger constructs goldpinger's logger around a zap.AtomicLevel,
+// instead of the fixed level a one-shot zap.Config used to bake in, so the
+// level can be changed at runtime through LogLevelHandler without a
+// restart. format selects "json" or "console" encoding; samplingInitial and
+// samplingThereafter follow zap's own SamplingConfig semantics and exist so
+// a probe storm on a broken cluster logging once per pod per tick doesn't
+// turn into log-I/O-bound node pressure.
+func BuildLogger(logLevel, format string, samplingInitial, samplingThereafter int) (*zap.Logger, zap.AtomicLevel, error) {
+	level := zap.NewAtomicLevel()
+	if err := level.UnmarshalText([]byte(strings.ToLower(logLevel))); err != nil {
+		level.SetLevel(zap.InfoLevel)
+	}
+
+	var cfg zap.Config
+	if level.Level() == zap.DebugLevel {
+		cfg = zap.NewDevelopmentConfig()
+	} else {
+		cfg = zap.NewProductionConfig()
+	}
+	cfg.Level = level
+
+	switch strings.ToLower(format) {
+	case "json":
+		cfg.Encoding = "json"
+	default:
+		cfg.Encoding = "console"
+		cfg.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	}
+
+	if samplingInitial > 0 || samplingThereafter > 0 {
+		cfg.Sampling = &zap.SamplingConfig{
+			Initial:    samplingInitial,
+			Thereafter: samplingThereafter,
+		}
+	} else {
+		cfg.Sampling = nil
+	}
+
+	logger, err := cfg.Build()
+	if err != nil {
+		return nil, level, fmt.Errorf("could not build logger: %w", err)
+	}
+
+	return logger, level, nil
+}
+
+// LogLevelHandler serves level as a GET/PUT HTTP endpoint - the same shape
+// zap.AtomicLevel's own ServeHTTP ships, since zap.AtomicLevel already is an
+// http.Handler - wrapped in HTTP basic auth against username/password.
+// Mounted at /debug/log-level, it lets an operator raise the level on a
+// single pod to chase down a flaky probe without a rollout. Callers who
+// explicitly want it unauthenticated (--debug-disable-auth) should mount
+// level directly instead of going through this handler.
+func LogLevelHandler(level zap.AtomicLevel, username, password string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		validUser := subtle.ConstantTimeCompare([]byte(user), []byte(username)) == 1
+		validPass := subtle.ConstantTimeCompare([]byte(pass), []byte(password)) == 1
+		if !ok || !validUser || !validPass {
+			w.Header().Set("WWW-Authenticate", `Basic realm="goldpinger"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		level.ServeHTTP(w, r)
+	})
+}
+
+// GenerateDebugPassword returns a random hex password for /debug/log-level,
+// used by main() when --debug-password is left unset so the endpoint is
+// authenticated by default instead of falling back to no auth at all.
+func GenerateDebugPassword() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("could not generate a random debug password: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,111 @@
+// Copyright 2018 Bloomberg Finance L.P.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goldpinger
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLogLevelHandlerFlipsLevelOverHTTP(t *testing.T) {
+	level := zap.NewAtomicLevelAt(zap.InfoLevel)
+	core, logs := observer.New(level)
+	logger := zap.New(core)
+
+	restore := zap.ReplaceGlobals(logger)
+	defer restore()
+
+	srv := httptest.NewServer(LogLevelHandler(level, "admin", "secret"))
+	defer srv.Close()
+
+	zap.L().Debug("should not be logged yet")
+	if logs.Len() != 0 {
+		t.Fatalf("expected no debug logs before raising the level, got %d", logs.Len())
+	}
+
+	req, err := http.NewRequest(http.MethodPut, srv.URL, strings.NewReader(`{"level":"debug"}`))
+	if err != nil {
+		t.Fatalf("could not build PUT request: %v", err)
+	}
+	req.SetBasicAuth("admin", "secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("PUT /debug/log-level failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 from PUT /debug/log-level, got %d", resp.StatusCode)
+	}
+	if level.Level() != zap.DebugLevel {
+		t.Fatalf("expected level to be debug after the PUT, got %v", level.Level())
+	}
+
+	zap.L().Debug("should be logged now")
+	if logs.Len() != 1 {
+		t.Fatalf("expected exactly one debug log after raising the level, got %d", logs.Len())
+	}
+}
+
+func TestLogLevelHandlerRequiresAuthWhenConfigured(t *testing.T) {
+	level := zap.NewAtomicLevelAt(zap.InfoLevel)
+	srv := httptest.NewServer(LogLevelHandler(level, "admin", "secret"))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("GET /debug/log-level failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without credentials, got %d", resp.StatusCode)
+	}
+}
+
+func TestLogLevelHandlerRequiresAuthByDefault(t *testing.T) {
+	level := zap.NewAtomicLevelAt(zap.InfoLevel)
+	srv := httptest.NewServer(LogLevelHandler(level, "goldpinger", ""))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("GET /debug/log-level failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 with no password configured, got %d", resp.StatusCode)
+	}
+}
+
+func TestGenerateDebugPasswordIsRandomAndNonEmpty(t *testing.T) {
+	a, err := GenerateDebugPassword()
+	if err != nil {
+		t.Fatalf("GenerateDebugPassword failed: %v", err)
+	}
+	b, err := GenerateDebugPassword()
+	if err != nil {
+		t.Fatalf("GenerateDebugPassword failed: %v", err)
+	}
+	if a == "" || b == "" {
+		t.Fatal("expected a non-empty generated password")
+	}
+	if a == b {
+		t.Fatal("expected two calls to GenerateDebugPassword to differ")
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2018 Bloomberg Finance L.P.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goldpinger
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"plugin"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+// ProbeOptions carries the per-target configuration a ProbeSpec declares for
+// a custom probe.
+type ProbeOptions struct {
+	Timeout time.Duration
+	Params  map[string]string
+}
+
+// ProbeResult is what a custom Prober reports back for a single probe.
+type ProbeResult struct {
+	Success  bool
+	Duration time.Duration
+	Message  string
+}
+
+// Prober is implemented by user-supplied probe types - gRPC health checks,
+// Redis PING, Kafka metadata fetches, mTLS mesh handshakes - that aren't
+// built into goldpinger. Implementations are loaded either from a .so built
+// against this interface (see LoadProberPlugins) or proxied over a local
+// gRPC sidecar (see NewGRPCProber).
+type Prober interface {
+	Probe(ctx context.Context, target string, opts ProbeOptions) (ProbeResult, error)
+}
+
+// ProbeSpec is the configuration of a custom probe: which registered Prober
+// to run, its timeout, and any probe-specific parameters. StartUpdater builds
+// one per --custom-probe name, with only Name set, and uses the same specs
+// for every neighbor.
+type ProbeSpec struct {
+	Name    string
+	Timeout time.Duration
+	Params  map[string]string
+}
+
+var (
+	probersMu sync.RWMutex
+	probers   = map[string]Prober{}
+)
+
+// probeDuration reports the duration of every probe, keyed by probe_type, so
+// custom probes flow through the same Prometheus surface as the built-in
+// tcp/http/dns/icmp/udp ones.
+var probeDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name: "goldpinger_probe_duration_seconds",
+	Help: "Duration of a single probe, by probe type.",
+}, []string{"probe_type", "success"})
+
+// RegisterProber makes a Prober available under name for use in a
+// ProbeSpec.Name. Plugins and the gRPC sidecar client both register
+// themselves through this.
+func RegisterProber(name string, p Prober) {
+	probersMu.Lock()
+	defer probersMu.Unlock()
+	probers[name] = p
+}
+
+// GetProber looks up a Prober previously registered under name.
+func GetProber(name string) (Prober, bool) {
+	probersMu.RLock()
+	defer probersMu.RUnlock()
+	p, ok := probers[name]
+	return p, ok
+}
+
+// LoadProberPlugins opens every *.so in dir and registers the Prober value
+// each one exports under the symbol "Prober", so operators can add
+// cluster-specific reachability checks without forking the binary.
+func LoadProberPlugins(dir string) error {
+	if dir == "" {
+		return nil
+	}
+
+	matches, err := filepath.Glob(filepath.Join(dir, "*.so"))
+	if err != nil {
+		return fmt.Errorf("could not glob probe plugin dir %q: %w", dir, err)
+	}
+
+	for _, path := range matches {
+		name := filepath.Base(path)
+		name = name[:len(name)-len(filepath.Ext(name))]
+
+		plug, err := plugin.Open(path)
+		if err != nil {
+			return fmt.Errorf("could not open probe plugin %q: %w", path, err)
+		}
+
+		sym, err := plug.Lookup("Prober")
+		if err != nil {
+			return fmt.Errorf("probe plugin %q does not export a Prober symbol: %w", path, err)
+		}
+
+		prober, ok := sym.(Prober)
+		if !ok {
+			proberPtr, ok := sym.(*Prober)
+			if !ok {
+				return fmt.Errorf("probe plugin %q's Prober symbol does not implement goldpinger.Prober", path)
+			}
+			prober = *proberPtr
+		}
+
+		RegisterProber(name, prober)
+		zap.L().Info("Loaded probe plugin", zap.String("name", name), zap.String("path", path))
+	}
+
+	return nil
+}
+
+// defaultProbeTimeout is used whenever a ProbeSpec omits Timeout, so a
+// zero-value spec doesn't hand Probers an already-expired context.
+const defaultProbeTimeout = 10 * time.Second
+
+// doCustomProbe runs the Prober registered under spec.Name against target,
+// recording its duration and outcome the same way the built-in probes do.
+func doCustomProbe(ctx context.Context, target string, spec ProbeSpec) (ProbeResult, error) {
+	prober, ok := GetProber(spec.Name)
+	if !ok {
+		return ProbeResult{}, fmt.Errorf("no prober registered under name %q", spec.Name)
+	}
+
+	timeout := spec.Timeout
+	if timeout <= 0 {
+		timeout = defaultProbeTimeout
+	}
+
+	startTime := time.Now()
+	result, err := prober.Probe(ctx, target, ProbeOptions{Timeout: timeout, Params: spec.Params})
+	duration := time.Since(startTime)
+	if result.Duration == 0 {
+		result.Duration = duration
+	}
+
+	success := "true"
+	if err != nil || !result.Success {
+		success = "false"
+	}
+	probeDuration.WithLabelValues(spec.Name, success).Observe(duration.Seconds())
+
+	if err != nil {
+		zap.L().Warn("Custom probe failed",
+			zap.String("probe_type", spec.Name),
+			zap.String("target", target),
+			zap.Duration("duration", duration),
+			zap.Error(err),
+		)
+		return result, err
+	}
+
+	zap.L().Debug("Custom probe completed",
+		zap.String("probe_type", spec.Name),
+		zap.String("target", target),
+		zap.Bool("success", result.Success),
+		zap.Duration("duration", duration),
+	)
+	return result, nil
+}
@@ -16,18 +16,83 @@ package goldpinger
 
 import (
 	"context"
-	"crypto/tls"
 	"fmt"
 	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.uber.org/zap"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
 )
 
+const (
+	protocolICMP     = 1
+	protocolIPv6ICMP = 58
+)
+
+// SupportedProbeProtocols lists the protocol names accepted by
+// --probe-protocols. CheckNeighbor runs all of them when
+// GoldpingerConfig.ProbeProtocols is empty; a configured name outside this
+// list is reported as a failed probe with an unknown-protocol error.
+var SupportedProbeProtocols = []string{"dns", "tcp", "http", "icmp", "udp"}
+
+// httpTransport is shared by every plain-HTTP probe so connections are
+// pooled across calls rather than dialed fresh each tick.
+var httpTransport = &http.Transport{
+	Proxy: http.ProxyFromEnvironment,
+	DialContext: (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}).DialContext,
+	MaxIdleConns:          100,
+	IdleConnTimeout:       90 * time.Second,
+	TLSHandshakeTimeout:   10 * time.Second,
+	ExpectContinueTimeout: 1 * time.Second,
+}
+
+// httpsTransport is the HTTPS counterpart of httpTransport. It's built
+// lazily, once, from the TLS config derived from GoldpingerConfig, so that
+// the cost of loading a CA bundle or client keypair and the resulting TLS
+// session cache are paid once rather than on every HTTPS probe.
+var (
+	httpsTransportOnce sync.Once
+	httpsTransport     *http.Transport
+	httpsTransportErr  error
+)
+
+func getHTTPSTransport() (*http.Transport, error) {
+	httpsTransportOnce.Do(func() {
+		tlsConfig, err := buildTLSConfig()
+		if err != nil {
+			httpsTransportErr = err
+			return
+		}
+		httpsTransport = &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+			TLSClientConfig:       tlsConfig,
+		}
+	})
+	return httpsTransport, httpsTransportErr
+}
+
 func doDNSProbe(addr string, timeout time.Duration) error {
-	zap.L().Debug("Starting DNS probe", zap.String("addr", addr), zap.Duration("timeout", timeout))
+	if ce := zap.L().Check(zap.DebugLevel, "Starting DNS probe"); ce != nil {
+		ce.Write(zap.String("addr", addr), zap.Duration("timeout", timeout))
+	}
 
 	resolver := net.Resolver{}
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
@@ -54,17 +119,21 @@ func doDNSProbe(addr string, timeout time.Duration) error {
 		return fmt.Errorf("%s was resolved to 0 ips", addr)
 	}
 
-	zap.L().Info("DNS probe successful",
-		zap.String("addr", addr),
-		zap.Strings("resolved_ips", ips),
-		zap.Int("ip_count", len(ips)),
-		zap.Duration("duration", duration),
-	)
+	if ce := zap.L().Check(zap.InfoLevel, "DNS probe successful"); ce != nil {
+		ce.Write(
+			zap.String("addr", addr),
+			zap.Strings("resolved_ips", ips),
+			zap.Int("ip_count", len(ips)),
+			zap.Duration("duration", duration),
+		)
+	}
 	return nil
 }
 
 func doTCPProbe(addr string, timeout time.Duration) error {
-	zap.L().Debug("Starting TCP probe", zap.String("addr", addr), zap.Duration("timeout", timeout))
+	if ce := zap.L().Check(zap.DebugLevel, "Starting TCP probe"); ce != nil {
+		ce.Write(zap.String("addr", addr), zap.Duration("timeout", timeout))
+	}
 
 	startTime := time.Now()
 	conn, err := net.DialTimeout("tcp", addr, timeout)
@@ -95,15 +164,14 @@ func doTCPProbe(addr string, timeout time.Duration) error {
 	}
 
 	if conn != nil {
-		localAddr := conn.LocalAddr().String()
-		remoteAddr := conn.RemoteAddr().String()
-
-		zap.L().Info("TCP probe successful",
-			zap.String("addr", addr),
-			zap.String("local_addr", localAddr),
-			zap.String("remote_addr", remoteAddr),
-			zap.Duration("duration", duration),
-		)
+		if ce := zap.L().Check(zap.InfoLevel, "TCP probe successful"); ce != nil {
+			ce.Write(
+				zap.String("addr", addr),
+				zap.String("local_addr", conn.LocalAddr().String()),
+				zap.String("remote_addr", conn.RemoteAddr().String()),
+				zap.Duration("duration", duration),
+			)
+		}
 		defer conn.Close()
 	}
 
@@ -111,7 +179,9 @@ func doTCPProbe(addr string, timeout time.Duration) error {
 }
 
 func doHTTPProbe(addr string, timeout time.Duration) error {
-	zap.L().Debug("Starting HTTP probe", zap.String("addr", addr), zap.Duration("timeout", timeout))
+	if ce := zap.L().Check(zap.DebugLevel, "Starting HTTP probe"); ce != nil {
+		ce.Write(zap.String("addr", addr), zap.Duration("timeout", timeout))
+	}
 
 	startTime := time.Now()
 
@@ -134,54 +204,36 @@ func doHTTPProbe(addr string, timeout time.Duration) error {
 		return fmt.Errorf("invalid url scheme: '%s' in address", u.Scheme)
 	}
 
-	zap.L().Debug("URL parsed successfully",
-		zap.String("addr", addr),
-		zap.String("scheme", u.Scheme),
-		zap.String("host", u.Host),
-		zap.String("path", u.Path),
-	)
+	if ce := zap.L().Check(zap.DebugLevel, "URL parsed successfully"); ce != nil {
+		ce.Write(
+			zap.String("addr", addr),
+			zap.String("scheme", u.Scheme),
+			zap.String("host", u.Host),
+			zap.String("path", u.Path),
+		)
+	}
 
-	// Configure HTTP client
+	// Configure HTTP client, reusing the pooled package-level transport for
+	// the scheme instead of tearing down and rebuilding TLS state per call.
 	client := http.Client{Timeout: timeout}
-
-	// Configure transport based on scheme
 	if u.Scheme == "https" {
-		zap.L().Debug("Configuring HTTPS transport with TLS skip verify",
-			zap.String("addr", addr),
-		)
-		client.Transport = &http.Transport{
-			Proxy: http.ProxyFromEnvironment,
-			DialContext: (&net.Dialer{
-				Timeout:   30 * time.Second,
-				KeepAlive: 30 * time.Second,
-			}).DialContext,
-			MaxIdleConns:          100,
-			IdleConnTimeout:       90 * time.Second,
-			TLSHandshakeTimeout:   10 * time.Second,
-			ExpectContinueTimeout: 1 * time.Second,
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: true,
-			},
+		transport, err := getHTTPSTransport()
+		if err != nil {
+			zap.L().Error("Failed to build TLS config for HTTPS probe",
+				zap.String("addr", addr),
+				zap.Error(err),
+			)
+			return err
 		}
+		client.Transport = transport
 	} else {
-		zap.L().Debug("Configuring HTTP transport",
-			zap.String("addr", addr),
-		)
-		client.Transport = &http.Transport{
-			Proxy: http.ProxyFromEnvironment,
-			DialContext: (&net.Dialer{
-				Timeout:   30 * time.Second,
-				KeepAlive: 30 * time.Second,
-			}).DialContext,
-			MaxIdleConns:          100,
-			IdleConnTimeout:       90 * time.Second,
-			TLSHandshakeTimeout:   10 * time.Second,
-			ExpectContinueTimeout: 1 * time.Second,
-		}
+		client.Transport = httpTransport
 	}
 
 	// Perform HTTP GET request
-	zap.L().Debug("Sending HTTP GET request", zap.String("addr", addr))
+	if ce := zap.L().Check(zap.DebugLevel, "Sending HTTP GET request"); ce != nil {
+		ce.Write(zap.String("addr", addr))
+	}
 	resp, err := client.Get(addr)
 	duration := time.Since(startTime)
 
@@ -213,21 +265,23 @@ func doHTTPProbe(addr string, timeout time.Duration) error {
 
 	defer resp.Body.Close()
 
-	// Log response details
-	contentLength := resp.ContentLength
-	contentType := resp.Header.Get("Content-Type")
-	server := resp.Header.Get("Server")
+	if resp.TLS != nil {
+		recordCertExpiry(u.Host, resp.TLS.PeerCertificates)
+	}
 
-	zap.L().Debug("HTTP probe received response",
-		zap.String("addr", addr),
-		zap.Int("status_code", resp.StatusCode),
-		zap.String("status", resp.Status),
-		zap.String("proto", resp.Proto),
-		zap.Int64("content_length", contentLength),
-		zap.String("content_type", contentType),
-		zap.String("server", server),
-		zap.Duration("duration", duration),
-	)
+	// Log response details
+	if ce := zap.L().Check(zap.DebugLevel, "HTTP probe received response"); ce != nil {
+		ce.Write(
+			zap.String("addr", addr),
+			zap.Int("status_code", resp.StatusCode),
+			zap.String("status", resp.Status),
+			zap.String("proto", resp.Proto),
+			zap.Int64("content_length", resp.ContentLength),
+			zap.String("content_type", resp.Header.Get("Content-Type")),
+			zap.String("server", resp.Header.Get("Server")),
+			zap.Duration("duration", duration),
+		)
+	}
 
 	// Check status code
 	if resp.StatusCode != 200 {
@@ -240,11 +294,249 @@ func doHTTPProbe(addr string, timeout time.Duration) error {
 		return fmt.Errorf("%s returned non-200 resp: %d", addr, resp.StatusCode)
 	}
 
-	zap.L().Info("HTTP probe successful",
+	if ce := zap.L().Check(zap.InfoLevel, "HTTP probe successful"); ce != nil {
+		ce.Write(
+			zap.String("addr", addr),
+			zap.Int("status_code", resp.StatusCode),
+			zap.Duration("duration", duration),
+		)
+	}
+
+	return nil
+}
+
+// icmpEchoID identifies this process's echo requests on a shared raw ICMP
+// socket; icmpSeq is bumped per probe so concurrent in-flight probes to
+// different neighbors can tell their own reply apart from one another and
+// from unrelated ICMP traffic the kernel delivers to the same socket.
+var (
+	icmpEchoID = os.Getpid() & 0xffff
+	icmpSeq    int32
+)
+
+func nextICMPSeq() int {
+	return int(atomic.AddInt32(&icmpSeq, 1)) & 0xffff
+}
+
+// icmpPeerIP extracts the IP out of the net.Addr ReadFrom hands back, which
+// is a *net.IPAddr on a raw socket but a *net.UDPAddr on the unprivileged
+// SOCK_DGRAM fallback.
+func icmpPeerIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.IPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	default:
+		return nil
+	}
+}
+
+// doICMPProbe sends a single ICMP echo request to addr and waits for the
+// matching echo reply. It first tries a raw ICMP socket (requires
+// CAP_NET_RAW) and falls back to an unprivileged SOCK_DGRAM ICMP socket,
+// which the Linux kernel allows for any process whose gid falls within
+// net.ipv4.ping_group_range, so the probe still works in a restricted pod
+// security context.
+//
+// A raw ICMP socket receives every packet of that protocol delivered to the
+// host, not just the reply to this probe's own echo - with many neighbors
+// probed concurrently, each probe shares the kernel's delivery queue for its
+// protocol. So a single ReadFrom is not enough: doICMPProbe loops, discarding
+// replies that aren't from dst or don't carry this probe's own echo ID/Seq,
+// until a matching one arrives or the deadline set below expires.
+func doICMPProbe(addr string, timeout time.Duration) error {
+	zap.L().Debug("Starting ICMP probe", zap.String("addr", addr), zap.Duration("timeout", timeout))
+
+	startTime := time.Now()
+
+	dst, err := net.ResolveIPAddr("ip", addr)
+	if err != nil {
+		zap.L().Warn("ICMP probe failed to resolve address",
+			zap.String("addr", addr),
+			zap.Duration("duration", time.Since(startTime)),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	network := "ip4:icmp"
+	proto := protocolICMP
+	var echoType, replyType icmp.Type = ipv4.ICMPTypeEcho, ipv4.ICMPTypeEchoReply
+	if dst.IP.To4() == nil {
+		network = "ip6:ipv6-icmp"
+		proto = protocolIPv6ICMP
+		echoType = ipv6.ICMPTypeEchoRequest
+		replyType = ipv6.ICMPTypeEchoReply
+	}
+
+	conn, err := icmp.ListenPacket(network, "")
+	unprivileged := false
+	if err != nil {
+		zap.L().Debug("ICMP probe could not open raw socket, falling back to unprivileged ICMP",
+			zap.String("addr", addr),
+			zap.Error(err),
+		)
+		udpNetwork := "udp4"
+		if network == "ip6:ipv6-icmp" {
+			udpNetwork = "udp6"
+		}
+		conn, err = icmp.ListenPacket(udpNetwork, "")
+		if err != nil {
+			zap.L().Warn("ICMP probe failed to open socket",
+				zap.String("addr", addr),
+				zap.Duration("duration", time.Since(startTime)),
+				zap.Error(err),
+			)
+			return err
+		}
+		unprivileged = true
+	}
+	defer conn.Close()
+
+	seq := nextICMPSeq()
+	msg := icmp.Message{
+		Type: echoType,
+		Code: 0,
+		Body: &icmp.Echo{
+			ID:   icmpEchoID,
+			Seq:  seq,
+			Data: []byte("goldpinger"),
+		},
+	}
+	wb, err := msg.Marshal(nil)
+	if err != nil {
+		return err
+	}
+
+	var dstAddr net.Addr = dst
+	if unprivileged {
+		// Unprivileged ICMP sockets are addressed like UDP sockets; the
+		// kernel replaces the echo ID with the socket's own identifier.
+		dstAddr = &net.UDPAddr{IP: dst.IP}
+	}
+
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+	if _, err := conn.WriteTo(wb, dstAddr); err != nil {
+		zap.L().Warn("ICMP probe failed to send echo request",
+			zap.String("addr", addr),
+			zap.Duration("duration", time.Since(startTime)),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	reply := make([]byte, 1500)
+	for {
+		n, peer, err := conn.ReadFrom(reply)
+		duration := time.Since(startTime)
+		if err != nil {
+			zap.L().Warn("ICMP probe failed to read echo reply",
+				zap.String("addr", addr),
+				zap.Duration("duration", duration),
+				zap.Error(err),
+			)
+			return err
+		}
+
+		if !icmpPeerIP(peer).Equal(dst.IP) {
+			if ce := zap.L().Check(zap.DebugLevel, "ICMP probe ignoring reply from unrelated peer"); ce != nil {
+				ce.Write(zap.String("addr", addr), zap.String("peer", peer.String()))
+			}
+			continue
+		}
+
+		rm, err := icmp.ParseMessage(proto, reply[:n])
+		if err != nil {
+			zap.L().Warn("ICMP probe received unparseable reply",
+				zap.String("addr", addr),
+				zap.Duration("duration", duration),
+				zap.Error(err),
+			)
+			return err
+		}
+
+		if rm.Type != replyType {
+			if ce := zap.L().Check(zap.DebugLevel, "ICMP probe ignoring reply with unexpected type"); ce != nil {
+				ce.Write(zap.String("addr", addr), zap.String("peer", peer.String()))
+			}
+			continue
+		}
+
+		// On an unprivileged socket the kernel has rewritten the echo ID and
+		// only delivers replies to this socket's own ID, so only Seq is checked.
+		echo, ok := rm.Body.(*icmp.Echo)
+		if !ok || (!unprivileged && echo.ID != icmpEchoID) || echo.Seq != seq {
+			if ce := zap.L().Check(zap.DebugLevel, "ICMP probe ignoring reply with mismatched echo ID/Seq"); ce != nil {
+				ce.Write(zap.String("addr", addr), zap.String("peer", peer.String()))
+			}
+			continue
+		}
+
+		zap.L().Info("ICMP probe successful",
+			zap.String("addr", addr),
+			zap.String("peer", peer.String()),
+			zap.Bool("unprivileged", unprivileged),
+			zap.Duration("duration", duration),
+		)
+		return nil
+	}
+}
+
+// doUDPProbe sends a small payload to addr over UDP and waits for either a
+// reply or the ICMP port-unreachable error the kernel surfaces as a failed
+// read on the same socket. UDP has no handshake, so unlike doTCPProbe a
+// successful Dial only proves routing, not reachability of anything
+// listening at the other end; the read is what tells those two apart.
+func doUDPProbe(addr string, timeout time.Duration) error {
+	zap.L().Debug("Starting UDP probe", zap.String("addr", addr), zap.Duration("timeout", timeout))
+
+	startTime := time.Now()
+	conn, err := net.DialTimeout("udp", addr, timeout)
+	if err != nil {
+		zap.L().Warn("UDP probe failed to dial",
+			zap.String("addr", addr),
+			zap.Duration("duration", time.Since(startTime)),
+			zap.Error(err),
+		)
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+
+	if _, err := conn.Write([]byte("goldpinger-udp-probe")); err != nil {
+		zap.L().Warn("UDP probe failed to send payload",
+			zap.String("addr", addr),
+			zap.Duration("duration", time.Since(startTime)),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	buf := make([]byte, 512)
+	n, err := conn.Read(buf)
+	duration := time.Since(startTime)
+	if err != nil {
+		// Either a read timeout (nothing answered) or an ICMP
+		// port-unreachable bounced back through the connected socket; both
+		// mean the probe failed.
+		zap.L().Warn("UDP probe got no reply",
+			zap.String("addr", addr),
+			zap.Duration("duration", duration),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	zap.L().Info("UDP probe successful",
 		zap.String("addr", addr),
-		zap.Int("status_code", resp.StatusCode),
+		zap.Int("reply_bytes", n),
 		zap.Duration("duration", duration),
 	)
-
 	return nil
 }
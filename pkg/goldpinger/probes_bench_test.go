@@ -0,0 +1,51 @@
+// Copyright 2018 Bloomberg Finance L.P.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goldpinger
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// BenchmarkDoHTTPProbeMesh exercises doHTTPProbe against a synthetic
+// 500-pod mesh. It's the before/after comparison for hoisting the
+// http.Transport out of doHTTPProbe into a package-level singleton: run it
+// against a checkout before that change to see the cost of dialing and
+// discarding a fresh transport (and, for HTTPS, its TLS session state) on
+// every single probe.
+func BenchmarkDoHTTPProbeMesh(b *testing.B) {
+	const meshSize = 500
+
+	servers := make([]*httptest.Server, meshSize)
+	for i := range servers {
+		servers[i] = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+	}
+	defer func() {
+		for _, s := range servers {
+			s.Close()
+		}
+	}()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := doHTTPProbe(servers[i%meshSize].URL, time.Second); err != nil {
+			b.Fatalf("doHTTPProbe: %v", err)
+		}
+	}
+}
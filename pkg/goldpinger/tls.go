@@ -0,0 +1,78 @@
+// Copyright 2018 Bloomberg Finance L.P.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goldpinger
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// certExpirySeconds reports, per probed host, the number of seconds until
+// that host's leaf TLS certificate expires. It lets operators alert on
+// upcoming expirations of neighbor pods sitting behind a service mesh
+// sidecar, instead of finding out when probes start failing.
+var certExpirySeconds = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "goldpinger_tls_cert_expiry_seconds",
+	Help: "Seconds until the peer's leaf TLS certificate expires, as observed on the last HTTPS probe that got a response.",
+}, []string{"host"})
+
+// buildTLSConfig assembles a *tls.Config from GoldpingerConfig's TLS options.
+// Verification is enabled by default; GoldpingerConfig.TLSInsecureSkipVerify
+// is an explicit, documented opt-out for probing endpoints goldpinger
+// doesn't otherwise trust.
+func buildTLSConfig() (*tls.Config, error) {
+	cfg := &tls.Config{
+		InsecureSkipVerify: GoldpingerConfig.TLSInsecureSkipVerify,
+		ServerName:         GoldpingerConfig.TLSServerName,
+	}
+
+	if GoldpingerConfig.TLSCAFile != "" {
+		pem, err := os.ReadFile(GoldpingerConfig.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read TLS CA file %q: %w", GoldpingerConfig.TLSCAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in TLS CA file %q", GoldpingerConfig.TLSCAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if GoldpingerConfig.TLSClientCertFile != "" || GoldpingerConfig.TLSClientKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(GoldpingerConfig.TLSClientCertFile, GoldpingerConfig.TLSClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load TLS client keypair: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+// recordCertExpiry updates the goldpinger_tls_cert_expiry_seconds gauge for
+// addr (the probed host:port) from the leaf certificate presented during a
+// probe's TLS handshake.
+func recordCertExpiry(addr string, certs []*x509.Certificate) {
+	if len(certs) == 0 {
+		return
+	}
+	certExpirySeconds.WithLabelValues(addr).Set(time.Until(certs[0].NotAfter).Seconds())
+}
@@ -0,0 +1,125 @@
+// Copyright 2018 Bloomberg Finance L.P.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goldpinger
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"go.uber.org/zap"
+)
+
+var (
+	neighborResultsMu sync.RWMutex
+	neighborResults   = map[string]CheckResults{}
+)
+
+// LatestResults returns CheckNeighbor's result against every peer discovered
+// on the last StartUpdater tick, keyed by pod name, for /check_all to serve.
+func LatestResults() map[string]CheckResults {
+	neighborResultsMu.RLock()
+	defer neighborResultsMu.RUnlock()
+
+	results := make(map[string]CheckResults, len(neighborResults))
+	for pod, result := range neighborResults {
+		results[pod] = result
+	}
+	return results
+}
+
+// StartUpdater starts the background loop that checks every peer on
+// GoldpingerConfig.CheckInterval, keeping LatestResults up to date. It's the
+// real check-loop entry point, started from main() once the API server is
+// configured.
+func StartUpdater() {
+	go func() {
+		checkNeighbors()
+
+		interval := GoldpingerConfig.CheckInterval
+		if interval <= 0 {
+			interval = 5 * time.Second
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			checkNeighbors()
+		}
+	}()
+}
+
+// checkNeighbors lists every goldpinger peer pod, runs CheckNeighbor against
+// each one's pod IP and publishes the results for LatestResults to serve.
+func checkNeighbors() {
+	clientset := GoldpingerConfig.KubernetesClient
+	if clientset == nil {
+		zap.L().Warn("Updater tick skipped: no kubernetes client configured")
+		return
+	}
+
+	namespace := PodNamespace
+	if GoldpingerConfig.Namespace != nil {
+		namespace = *GoldpingerConfig.Namespace
+	}
+
+	pods, err := clientset.CoreV1().Pods(namespace).List(context.Background(), metav1.ListOptions{
+		LabelSelector: "app=goldpinger",
+	})
+	if err != nil {
+		zap.L().Warn("Updater tick could not list peer pods", zap.Error(err))
+		return
+	}
+
+	neighbors := selectNeighbors(pods.Items)
+
+	timeout := GoldpingerConfig.CheckTimeout
+	if timeout <= 0 {
+		timeout = defaultProbeTimeout
+	}
+
+	specs := make([]ProbeSpec, len(GoldpingerConfig.CustomProbes))
+	for i, name := range GoldpingerConfig.CustomProbes {
+		specs[i] = ProbeSpec{Name: name}
+	}
+
+	results := make(map[string]CheckResults, len(neighbors))
+	for _, pod := range neighbors {
+		results[pod.Name] = CheckNeighbor(pod.Status.PodIP, GoldpingerConfig.Port, timeout, specs...)
+	}
+
+	neighborResultsMu.Lock()
+	neighborResults = results
+	neighborResultsMu.Unlock()
+}
+
+// selectNeighbors drops this pod itself and anything not yet assigned an IP,
+// then caps the result to GoldpingerConfig.PingNumber peers, if set.
+func selectNeighbors(pods []corev1.Pod) []corev1.Pod {
+	neighbors := make([]corev1.Pod, 0, len(pods))
+	for _, pod := range pods {
+		if pod.Status.PodIP == "" || pod.Status.PodIP == GoldpingerConfig.PodIP {
+			continue
+		}
+		neighbors = append(neighbors, pod)
+	}
+
+	if n := GoldpingerConfig.PingNumber; n > 0 && n < len(neighbors) {
+		neighbors = neighbors[:n]
+	}
+	return neighbors
+}